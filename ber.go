@@ -2,15 +2,24 @@ package ber
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
 )
 
 type Packet struct {
 	ClassType   uint8
 	TagType     uint8
 	Tag         uint8
+	LongTag     uint64
+	Indefinite  bool
 	Value       interface{}
 	Data        *bytes.Buffer
 	Children    []*Packet
@@ -142,6 +151,9 @@ func printPacket(p *Packet, indent int, printBytes bool) {
 	if p.ClassType == ClassUniversal {
 		tagStr = TagMap[p.Tag]
 	}
+	if p.Tag == TagBitmask {
+		tagStr = fmt.Sprintf("0x%02X (long form)", p.LongTag)
+	}
 
 	value := fmt.Sprint(p.Value)
 	description := ""
@@ -160,56 +172,121 @@ func printPacket(p *Packet, indent int, printBytes bool) {
 	}
 }
 
-func resizeBuffer(in []byte, newSize uint64) (out []byte) {
-	out = make([]byte, newSize)
-	copy(out, in)
-	return
-}
+// readRawPacket reads exactly one BER TLV unit from reader, including any
+// nested TLVs and EOC markers needed to resolve an indefinite-length
+// constructed encoding, and returns the raw bytes for DecodePacketErr to
+// interpret. first, if non-nil, is an identifier octet already consumed
+// from reader (used while looking ahead for an EOC inside indefinite-length
+// content).
+func readRawPacket(reader io.Reader, first []byte) ([]byte, error) {
+	var idByte byte
+	if len(first) == 1 {
+		idByte = first[0]
+	} else {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(reader, b); err != nil {
+			return nil, err
+		}
+		idByte = b[0]
+	}
+	buf := []byte{idByte}
 
-func ReadPacket(reader io.Reader) (*Packet, error) {
-	buf := make([]byte, 2)
-	if _, err := io.ReadFull(reader, buf); err != nil {
+	if idByte&TagBitmask == TagBitmask {
+		for {
+			b := make([]byte, 1)
+			if _, err := io.ReadFull(reader, b); err != nil {
+				return nil, err
+			}
+			buf = append(buf, b[0])
+			if b[0]&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	lengthByte := make([]byte, 1)
+	if _, err := io.ReadFull(reader, lengthByte); err != nil {
 		return nil, err
 	}
-	idx := uint64(2)
-	datalen := uint64(buf[1])
-	if Debug {
-		fmt.Printf("Read: datalen = %d len(buf) = %d ", datalen, len(buf))
-		for _, b := range buf {
-			fmt.Printf("%02X ", b)
+	buf = append(buf, lengthByte[0])
+
+	if lengthByte[0] == 0xFF {
+		return nil, ErrReservedLength
+	}
+
+	if lengthByte[0] == 0x80 {
+		if idByte&TypeBitmask != TypeConstructed {
+			return nil, fmt.Errorf("ber: indefinite length is not valid on a primitive encoding")
 		}
-		fmt.Printf("\n")
+		for {
+			next := make([]byte, 1)
+			if _, err := io.ReadFull(reader, next); err != nil {
+				return nil, err
+			}
+			if next[0] == TagEOC {
+				term := make([]byte, 1)
+				if _, err := io.ReadFull(reader, term); err != nil {
+					return nil, err
+				}
+				if term[0] != 0x00 {
+					return nil, fmt.Errorf("ber: malformed end-of-contents octets")
+				}
+				buf = append(buf, TagEOC, 0x00)
+				break
+			}
+			child, err := readRawPacket(reader, next)
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, child...)
+		}
+		return buf, nil
 	}
-	if datalen&128 != 0 {
-		a := datalen - 128
-		idx += a
-		buf = resizeBuffer(buf, 2+a)
-		if _, err := io.ReadFull(reader, buf[2:]); err != nil {
+
+	var datalen uint64
+	if lengthByte[0]&128 != 0 {
+		numOctets := uint64(lengthByte[0] &^ 128)
+		if numOctets > 8 {
+			return nil, ErrLengthOverflow
+		}
+		lenBytes := make([]byte, numOctets)
+		if _, err := io.ReadFull(reader, lenBytes); err != nil {
 			return nil, err
 		}
-		datalen = DecodeInteger(buf[2 : 2+a])
-		if Debug {
-			fmt.Printf("Read: a = %d  idx = %d  datalen = %d  len(buf) = %d", a, idx, datalen, len(buf))
-			for _, b := range buf {
-				fmt.Printf("%02X ", b)
-			}
-			fmt.Printf("\n")
+		buf = append(buf, lenBytes...)
+		datalen = DecodeInteger(lenBytes)
+	} else {
+		datalen = uint64(lengthByte[0])
+	}
+
+	if datalen > 0 {
+		content := make([]byte, datalen)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, err
 		}
+		buf = append(buf, content...)
 	}
 
-	buf = resizeBuffer(buf, idx+datalen)
-	if _, err := io.ReadFull(reader, buf[idx:]); err != nil {
+	return buf, nil
+}
+
+func ReadPacket(reader io.Reader) (*Packet, error) {
+	buf, err := readRawPacket(reader, nil)
+	if err != nil {
 		return nil, err
 	}
-
 	if Debug {
-		fmt.Printf("Read: len( buf ) = %d  idx=%d datalen=%d idx+datalen=%d\n", len(buf), idx, datalen, idx+datalen)
+		fmt.Printf("Read: len(buf) = %d ", len(buf))
 		for _, b := range buf {
 			fmt.Printf("%02X ", b)
 		}
+		fmt.Printf("\n")
 	}
-
-	return DecodePacket(buf), nil
+	p, _, err := DecodePacketErr(buf)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
 }
 
 // DecodeString returns a string version of data treating it as
@@ -249,15 +326,485 @@ func EncodeInteger(val uint64) []byte {
 	return out.Bytes()
 }
 
+// DecodeSignedInteger interprets data as a two's-complement, big-endian
+// ASN.1 INTEGER, sign-extending from the leading byte.
+func DecodeSignedInteger(data []byte) int64 {
+	var ret int64
+	if len(data) > 0 && data[0]&0x80 != 0 {
+		ret = -1
+	}
+	for _, b := range data {
+		ret = (ret << 8) | int64(b)
+	}
+	return ret
+}
+
+// EncodeSignedInteger returns the minimal two's-complement, big-endian
+// encoding of val, per X.690 - the form required for ASN.1 INTEGER and
+// ENUMERATED content octets.
+func EncodeSignedInteger(val int64) []byte {
+	numBytes := 1
+	for v := val; v > 127 || v < -128; v >>= 8 {
+		numBytes++
+	}
+	out := make([]byte, numBytes)
+	for i := numBytes - 1; i >= 0; i-- {
+		out[i] = byte(val)
+		val >>= 8
+	}
+	return out
+}
+
+// encodeBase128 encodes val as a base-128 variable-length quantity, the
+// continuation form used by both the high-tag-number identifier octets and
+// object identifier arcs: each octet carries 7 bits of val, most-significant
+// group first, with the high bit set on every octet but the last.
+func encodeBase128(val uint64) []byte {
+	if val == 0 {
+		return []byte{0x00}
+	}
+	var out []byte
+	for val > 0 {
+		out = append([]byte{byte(val & 0x7f)}, out...)
+		val >>= 7
+	}
+	for i := 0; i < len(out)-1; i++ {
+		out[i] |= 0x80
+	}
+	return out
+}
+
+// decodeBase128 reads a base-128 variable-length quantity from the front of
+// data and reports how many octets it consumed.
+func decodeBase128(data []byte) (val uint64, consumed int) {
+	for _, b := range data {
+		val = (val << 7) | uint64(b&0x7f)
+		consumed++
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return val, consumed
+}
+
+// ObjectIdentifier holds the arcs of an ASN.1 OBJECT IDENTIFIER or
+// RELATIVE-OID, e.g. {1 2 840 113549}.
+type ObjectIdentifier []uint64
+
+func (oid ObjectIdentifier) String() string {
+	arcs := make([]string, len(oid))
+	for i, arc := range oid {
+		arcs[i] = strconv.FormatUint(arc, 10)
+	}
+	return strings.Join(arcs, ".")
+}
+
+// BitString holds the decoded content of an ASN.1 BIT STRING: the raw
+// bytes plus the total number of significant bits they hold.
+type BitString struct {
+	Bytes     []byte
+	BitLength int
+}
+
+func decodeObjectIdentifier(data []byte) ObjectIdentifier {
+	if len(data) == 0 {
+		return nil
+	}
+	first, consumed := decodeBase128(data)
+	var arcs []uint64
+	switch {
+	case first < 40:
+		arcs = append(arcs, 0, first)
+	case first < 80:
+		arcs = append(arcs, 1, first-40)
+	default:
+		arcs = append(arcs, 2, first-80)
+	}
+	for data = data[consumed:]; len(data) > 0; {
+		arc, n := decodeBase128(data)
+		arcs = append(arcs, arc)
+		data = data[n:]
+	}
+	return arcs
+}
+
+func encodeObjectIdentifier(oid ObjectIdentifier) []byte {
+	if len(oid) < 2 {
+		return nil
+	}
+	out := encodeBase128(oid[0]*40 + oid[1])
+	for _, arc := range oid[2:] {
+		out = append(out, encodeBase128(arc)...)
+	}
+	return out
+}
+
+func decodeRelativeOID(data []byte) ObjectIdentifier {
+	var arcs []uint64
+	for len(data) > 0 {
+		arc, n := decodeBase128(data)
+		arcs = append(arcs, arc)
+		data = data[n:]
+	}
+	return arcs
+}
+
+func encodeRelativeOID(oid ObjectIdentifier) []byte {
+	var out []byte
+	for _, arc := range oid {
+		out = append(out, encodeBase128(arc)...)
+	}
+	return out
+}
+
+func decodeBitString(data []byte) BitString {
+	if len(data) == 0 {
+		return BitString{}
+	}
+	unused := int(data[0])
+	raw := data[1:]
+	bitLength := len(raw)*8 - unused
+	if bitLength < 0 {
+		bitLength = 0
+	}
+	return BitString{Bytes: raw, BitLength: bitLength}
+}
+
+func encodeBitString(value BitString) []byte {
+	unused := byte(len(value.Bytes)*8 - value.BitLength)
+	out := make([]byte, 0, len(value.Bytes)+1)
+	out = append(out, unused)
+	out = append(out, value.Bytes...)
+	return out
+}
+
+func decodeUTF16String(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+func decodeUTF32String(data []byte) string {
+	var sb strings.Builder
+	for i := 0; i+4 <= len(data); i += 4 {
+		sb.WriteRune(rune(uint32(data[i])<<24 | uint32(data[i+1])<<16 | uint32(data[i+2])<<8 | uint32(data[i+3])))
+	}
+	return sb.String()
+}
+
+// utcTimeFormats and generalizedTimeFormats are tried in order; seconds
+// (and, for GeneralizedTime, minutes and fractional seconds) may be omitted.
+// Every form requires the UTC designator "Z" or a numeric offset; a time
+// with no zone is not parsed.
+var utcTimeFormats = []string{
+	"060102150405Z0700",
+	"0601021504Z0700",
+}
+
+var generalizedTimeFormats = []string{
+	"20060102150405.999999999Z0700",
+	"20060102150405Z0700",
+	"200601021504Z0700",
+	"2006010215Z0700",
+}
+
+func decodeUTCTime(data []byte) (time.Time, error) {
+	s := string(data)
+	var t time.Time
+	var err error
+	for _, format := range utcTimeFormats {
+		if t, err = time.Parse(format, s); err == nil {
+			// X.680 §47.3: two-digit years 50-99 are 1950-1999, 00-49 are
+			// 2000-2049; Go's "06" layout instead pivots at 69, so shift the
+			// 2050-2068 range it produces back a century.
+			if t.Year() >= 2050 {
+				t = t.AddDate(-100, 0, 0)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+func decodeGeneralizedTime(data []byte) (time.Time, error) {
+	s := string(data)
+	var t time.Time
+	var err error
+	for _, format := range generalizedTimeFormats {
+		if t, err = time.Parse(format, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// decodeReal interprets data per X.690 §8.5: either a binary encoding
+// (base 2/8/16 mantissa and exponent), a decimal encoding (ISO 6093 NR
+// forms), or one of the special values +INF/-INF.
+func decodeReal(data []byte) (float64, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	first := data[0]
+	switch {
+	case first == 0x40:
+		return math.Inf(1), nil
+	case first == 0x41:
+		return math.Inf(-1), nil
+	case first&0x80 != 0:
+		sign := 1.0
+		if first&0x40 != 0 {
+			sign = -1.0
+		}
+		var base float64
+		switch (first >> 4) & 0x03 {
+		case 0:
+			base = 2
+		case 1:
+			base = 8
+		case 2:
+			base = 16
+		default:
+			return 0, fmt.Errorf("ber: reserved real base")
+		}
+		scale := uint((first >> 2) & 0x03)
+
+		rest := data[1:]
+		var expLen int
+		switch first & 0x03 {
+		case 0x03:
+			if len(rest) == 0 {
+				return 0, fmt.Errorf("ber: truncated real")
+			}
+			expLen = int(rest[0])
+			rest = rest[1:]
+		default:
+			expLen = int(first&0x03) + 1
+		}
+		if len(rest) < expLen {
+			return 0, fmt.Errorf("ber: truncated real")
+		}
+
+		exponent := DecodeSignedInteger(rest[:expLen])
+		mantissa := float64(DecodeInteger(rest[expLen:])) * float64(uint64(1)<<scale)
+		return sign * mantissa * math.Pow(base, float64(exponent)), nil
+	case first&0xc0 == 0x00:
+		v, err := strconv.ParseFloat(strings.TrimSpace(string(data[1:])), 64)
+		if err != nil {
+			return 0, err
+		}
+		return v, nil
+	default:
+		return 0, fmt.Errorf("ber: unsupported real encoding")
+	}
+}
+
+func encodeReal(val float64) []byte {
+	if val == 0 {
+		return nil
+	}
+	if math.IsInf(val, 1) {
+		return []byte{0x40}
+	}
+	if math.IsInf(val, -1) {
+		return []byte{0x41}
+	}
+
+	first := byte(0x80)
+	if val < 0 {
+		first |= 0x40
+		val = -val
+	}
+
+	mantissa, exponent := val, 0
+	for mantissa != math.Trunc(mantissa) {
+		mantissa *= 2
+		exponent--
+	}
+	for mantissa > 0 && math.Mod(mantissa, 2) == 0 {
+		mantissa /= 2
+		exponent++
+	}
+
+	mantissaBytes := EncodeInteger(uint64(mantissa))
+	exponentBytes := EncodeSignedInteger(int64(exponent))
+
+	var out []byte
+	switch len(exponentBytes) {
+	case 1:
+		out = append(out, first)
+	case 2:
+		out = append(out, first|0x01)
+	case 3:
+		out = append(out, first|0x02)
+	default:
+		out = append(out, first|0x03, byte(len(exponentBytes)))
+	}
+	out = append(out, exponentBytes...)
+	out = append(out, mantissaBytes...)
+	return out
+}
+
+// Errors returned by DecodePacketErr (and by ReadPacket) when data is not a
+// well-formed BER TLV. DecodePacket returns a nil packet instead.
+var (
+	ErrTruncated      = errors.New("ber: truncated packet")
+	ErrLengthOverflow = errors.New("ber: length overflows remaining data")
+	ErrReservedLength = errors.New("ber: reserved length octet 0xFF")
+)
+
+// DecodePacket decodes the leading BER TLV in data and discards the rest.
+// It returns nil if data is not a well-formed packet; use DecodePacketErr
+// to find out why.
 func DecodePacket(data []byte) *Packet {
-	p, _ := decodePacket(data)
+	p, _, err := decodePacketErr(data)
+	if err != nil {
+		return nil
+	}
 	return p
 }
 
-func decodePacket(data []byte) (*Packet, []byte) {
+// DecodePacketErr decodes the leading BER TLV in data, returning the
+// decoded Packet, the unconsumed remainder of data, and an error if data
+// is truncated or otherwise malformed.
+func DecodePacketErr(data []byte) (*Packet, []byte, error) {
+	return decodePacketErr(data)
+}
+
+// decodePacketErr decodes data under the permissive BER rules; it is the
+// ModeBER instance of the shared decodePacket implementation below.
+func decodePacketErr(data []byte) (*Packet, []byte, error) {
+	return decodePacket(data, ModeBER)
+}
+
+// decodeUniversalValue fills in p.Value for a primitive Universal-class
+// packet, given its already-extracted content octets.
+func decodeUniversalValue(p *Packet, valueData []byte) {
+	switch p.Tag {
+	case TagEOC:
+	case TagBoolean:
+		val := DecodeInteger(valueData)
+		p.Value = val != 0
+	case TagInteger:
+		p.Value = DecodeSignedInteger(valueData)
+	case TagBitString:
+		p.Value = decodeBitString(valueData)
+	case TagOctetString:
+		// should not be interpreted as Unicode code point
+		// p.Value = DecodeString(valueData)
+		p.Value = string(valueData)
+	case TagNULL:
+	case TagObjectIdentifier:
+		p.Value = decodeObjectIdentifier(valueData)
+	case TagObjectDescriptor:
+	case TagExternal:
+	case TagRealFloat:
+		if val, err := decodeReal(valueData); err == nil {
+			p.Value = val
+		}
+	case TagEnumerated:
+		p.Value = DecodeSignedInteger(valueData)
+	case TagEmbeddedPDV:
+	case TagUTF8String:
+		p.Value = string(valueData)
+	case TagRelativeOID:
+		p.Value = decodeRelativeOID(valueData)
+	case TagSequence:
+	case TagSet:
+	case TagNumericString:
+		p.Value = DecodeString(valueData)
+	case TagPrintableString:
+		p.Value = DecodeString(valueData)
+	case TagT61String:
+	case TagVideotexString:
+	case TagIA5String:
+		p.Value = DecodeString(valueData)
+	case TagUTCTime:
+		if val, err := decodeUTCTime(valueData); err == nil {
+			p.Value = val
+		}
+	case TagGeneralizedTime:
+		if val, err := decodeGeneralizedTime(valueData); err == nil {
+			p.Value = val
+		}
+	case TagGraphicString:
+	case TagVisibleString:
+		p.Value = DecodeString(valueData)
+	case TagGeneralString:
+		p.Value = DecodeString(valueData)
+	case TagUniversalString:
+		p.Value = decodeUTF32String(valueData)
+	case TagCharacterString:
+	case TagBMPString:
+		p.Value = decodeUTF16String(valueData)
+	}
+}
+
+// Mode selects which set of ASN.1 encoding rules DecodePacketStrict
+// enforces. BER is permissive about multiple valid encodings of the same
+// value; DER (the form X.509/PKCS signing requires) picks exactly one.
+type Mode int
+
+const (
+	ModeBER Mode = iota
+	ModeDER
+)
+
+// Errors returned by DecodePacketStrict in ModeDER for encodings that are
+// valid BER but not valid DER.
+var (
+	ErrDERIndefiniteLength  = errors.New("ber: indefinite length is not valid in DER")
+	ErrDERNonMinimalLength  = errors.New("ber: non-minimal length encoding is not valid in DER")
+	ErrDERConstructedString = errors.New("ber: constructed encoding of a primitive string/OID type is not valid in DER")
+	ErrDERBoolean           = errors.New("ber: BOOLEAN value other than 0x00/0xFF is not valid in DER")
+	ErrDERNonMinimalInteger = errors.New("ber: INTEGER/ENUMERATED has a redundant leading padding byte, not valid in DER")
+	ErrDERSetOrder          = errors.New("ber: SET OF elements are not in canonical order, not valid in DER")
+)
+
+// primitiveOnlyUniversalTags are Universal-class tags whose DER encoding
+// must always be primitive, never constructed (X.690 §10.2).
+var primitiveOnlyUniversalTags = map[uint8]bool{
+	TagBitString:        true,
+	TagOctetString:      true,
+	TagObjectIdentifier: true,
+	TagRelativeOID:      true,
+	TagUTF8String:       true,
+	TagNumericString:    true,
+	TagPrintableString:  true,
+	TagT61String:        true,
+	TagVideotexString:   true,
+	TagIA5String:        true,
+	TagGraphicString:    true,
+	TagVisibleString:    true,
+	TagGeneralString:    true,
+	TagUniversalString:  true,
+	TagBMPString:        true,
+}
+
+// DecodePacketStrict decodes the leading BER (mode == ModeBER) or DER
+// (mode == ModeDER) TLV in data. In ModeDER it additionally rejects
+// indefinite lengths, non-minimal length or INTEGER encodings, constructed
+// encodings of primitive string/OID types, non-canonical BOOLEAN octets,
+// and out-of-order SET OF elements.
+func DecodePacketStrict(data []byte, mode Mode) (*Packet, []byte, error) {
+	return decodePacket(data, mode)
+}
+
+// decodePacket is the single bounds-checked BER/DER TLV decoder: mode ==
+// ModeBER applies only the structural checks common to both rule sets,
+// while mode == ModeDER additionally enforces the stricter DER constraints.
+// decodePacketErr and DecodePacketStrict are both thin wrappers over this.
+func decodePacket(data []byte, mode Mode) (*Packet, []byte, error) {
 	if Debug {
 		fmt.Printf("decodePacket: enter %d\n", len(data))
 	}
+	if len(data) < 1 {
+		return nil, nil, ErrTruncated
+	}
+
 	p := &Packet{
 		ClassType: data[0] & ClassBitmask,
 		TagType:   data[0] & TypeBitmask,
@@ -265,94 +812,241 @@ func decodePacket(data []byte) (*Packet, []byte) {
 		Data:      new(bytes.Buffer),
 	}
 
-	datalen := DecodeInteger(data[1:2])
-	datapos := uint64(2)
-	if datalen&128 != 0 {
-		datalen -= 128
-		datapos += datalen
-		datalen = DecodeInteger(data[2 : 2+datalen])
+	pos := uint64(1)
+	if p.Tag == TagBitmask {
+		for {
+			if pos >= uint64(len(data)) {
+				return nil, nil, ErrTruncated
+			}
+			b := data[pos]
+			p.LongTag = (p.LongTag << 7) | uint64(b&0x7f)
+			pos++
+			if b&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if pos >= uint64(len(data)) {
+		return nil, nil, ErrTruncated
 	}
+	lengthByte := data[pos]
+	pos++
 
-	valueData := data[datapos : datapos+datalen]
+	if lengthByte == 0xFF {
+		return nil, nil, ErrReservedLength
+	}
+
+	var datalen uint64
+	switch {
+	case lengthByte == 0x80:
+		if mode == ModeDER {
+			return nil, nil, ErrDERIndefiniteLength
+		}
+		if p.TagType != TypeConstructed {
+			return nil, nil, fmt.Errorf("ber: indefinite length is not valid on a primitive encoding")
+		}
+		p.Indefinite = true
+		remaining := data[pos:]
+		for {
+			if len(remaining) < 2 {
+				return nil, nil, ErrTruncated
+			}
+			if remaining[0] == TagEOC && remaining[1] == 0x00 {
+				remaining = remaining[2:]
+				break
+			}
+			var child *Packet
+			var err error
+			child, remaining, err = decodePacket(remaining, mode)
+			if err != nil {
+				return nil, nil, err
+			}
+			p.AppendChild(child)
+		}
+		return p, remaining, nil
+	case lengthByte&0x80 != 0:
+		numOctets := uint64(lengthByte &^ 0x80)
+		if numOctets > 8 {
+			return nil, nil, ErrLengthOverflow
+		}
+		if pos+numOctets > uint64(len(data)) {
+			return nil, nil, ErrTruncated
+		}
+		lenOctets := data[pos : pos+numOctets]
+		if mode == ModeDER && (numOctets == 0 || lenOctets[0] == 0x00) {
+			return nil, nil, ErrDERNonMinimalLength
+		}
+		datalen = DecodeInteger(lenOctets)
+		if mode == ModeDER && datalen < 128 {
+			return nil, nil, ErrDERNonMinimalLength
+		}
+		pos += numOctets
+	default:
+		datalen = uint64(lengthByte)
+	}
+
+	if datalen > uint64(len(data))-pos {
+		return nil, nil, ErrLengthOverflow
+	}
+
+	valueData := data[pos : pos+datalen]
+
+	if mode == ModeDER && p.ClassType == ClassUniversal && p.TagType == TypeConstructed && primitiveOnlyUniversalTags[p.Tag] {
+		return nil, nil, ErrDERConstructedString
+	}
 
 	if p.TagType == TypeConstructed {
 		for len(valueData) != 0 {
 			var child *Packet
-			child, valueData = decodePacket(valueData)
+			var err error
+			child, valueData, err = decodePacket(valueData, mode)
+			if err != nil {
+				return nil, nil, err
+			}
 			p.AppendChild(child)
 		}
+		if mode == ModeDER && p.ClassType == ClassUniversal && p.Tag == TagSet {
+			for i := 1; i < len(p.Children); i++ {
+				if bytes.Compare(p.Children[i-1].Bytes(), p.Children[i].Bytes()) > 0 {
+					return nil, nil, ErrDERSetOrder
+				}
+			}
+		}
 	} else if p.ClassType == ClassUniversal {
-		p.Data.Write(data[datapos : datapos+datalen])
-		switch p.Tag {
-		case TagEOC:
-		case TagBoolean:
-			val := DecodeInteger(valueData)
-			p.Value = val != 0
-		case TagInteger:
-			p.Value = DecodeInteger(valueData)
-		case TagBitString:
-		case TagOctetString:
-			// should not be interpreted as Unicode code point
-			// p.Value = DecodeString(valueData)
-			p.Value = string(valueData)
-		case TagNULL:
-		case TagObjectIdentifier:
-		case TagObjectDescriptor:
-		case TagExternal:
-		case TagRealFloat:
-		case TagEnumerated:
-			p.Value = DecodeInteger(valueData)
-		case TagEmbeddedPDV:
-		case TagUTF8String:
-		case TagRelativeOID:
-		case TagSequence:
-		case TagSet:
-		case TagNumericString:
-		case TagPrintableString:
-			p.Value = DecodeString(valueData)
-		case TagT61String:
-		case TagVideotexString:
-		case TagIA5String:
-		case TagUTCTime:
-		case TagGeneralizedTime:
-		case TagGraphicString:
-		case TagVisibleString:
-		case TagGeneralString:
-		case TagUniversalString:
-		case TagCharacterString:
-		case TagBMPString:
+		p.Data.Write(data[pos : pos+datalen])
+		if mode == ModeDER {
+			switch {
+			case p.Tag == TagBoolean && (len(valueData) != 1 || (valueData[0] != 0x00 && valueData[0] != 0xFF)):
+				return nil, nil, ErrDERBoolean
+			case (p.Tag == TagInteger || p.Tag == TagEnumerated) && len(valueData) >= 2 &&
+				((valueData[0] == 0x00 && valueData[1]&0x80 == 0) || (valueData[0] == 0xFF && valueData[1]&0x80 != 0)):
+				return nil, nil, ErrDERNonMinimalInteger
+			}
 		}
+		decodeUniversalValue(p, valueData)
 	} else {
-		p.Data.Write(data[datapos : datapos+datalen])
+		p.Data.Write(data[pos : pos+datalen])
 	}
 
-	return p, data[datapos+datalen:]
+	return p, data[pos+datalen:], nil
+}
+
+// EncodeDER returns the canonical DER encoding of p: minimal-length form,
+// SET children sorted into ascending byte order, and primitive (never
+// constructed) encodings for string/OID types.
+func (p *Packet) EncodeDER() []byte {
+	var out bytes.Buffer
+
+	// BER allows fragmenting a primitive-only type (OCTET STRING, BIT
+	// STRING, an OID, any of the string types, ...) into a constructed
+	// sequence of same-tag pieces; DER forbids this, so such a packet must
+	// collapse to a single primitive TLV whose content is the concatenation
+	// of its fragments' raw octets, not their re-encoded TLVs.
+	forcePrimitive := p.ClassType == ClassUniversal && primitiveOnlyUniversalTags[p.Tag] && p.TagType == TypeConstructed
+
+	tagType := p.TagType
+	if forcePrimitive {
+		tagType = TypePrimitive
+	}
+	encodeIdentifier(&out, p.ClassType, tagType, p.Tag, p.LongTag)
+
+	var content []byte
+	switch {
+	case forcePrimitive:
+		content = derFragmentedContent(p)
+	case p.ClassType == ClassUniversal && p.Tag == TagBoolean && len(p.Children) == 0:
+		content = canonicalDERBoolean(p.Data.Bytes())
+	case len(p.Children) == 0:
+		content = p.Data.Bytes()
+	default:
+		childBytes := make([][]byte, len(p.Children))
+		for i, child := range p.Children {
+			childBytes[i] = child.EncodeDER()
+		}
+		if p.ClassType == ClassUniversal && p.Tag == TagSet {
+			sort.Slice(childBytes, func(i, j int) bool {
+				return bytes.Compare(childBytes[i], childBytes[j]) < 0
+			})
+		}
+		var buf bytes.Buffer
+		for _, cb := range childBytes {
+			buf.Write(cb)
+		}
+		content = buf.Bytes()
+	}
+
+	encodeLength(&out, uint64(len(content)))
+	out.Write(content)
+	return out.Bytes()
+}
+
+// canonicalDERBoolean returns the single-octet DER encoding of a BOOLEAN
+// value given its (possibly non-canonical, e.g. BER-style 0x01) content
+// octets: 0xFF if any content byte is nonzero, 0x00 otherwise.
+func canonicalDERBoolean(data []byte) []byte {
+	for _, b := range data {
+		if b != 0x00 {
+			return []byte{0xFF}
+		}
+	}
+	return []byte{0x00}
+}
+
+// derFragmentedContent flattens a BER constructed (fragmented) encoding of
+// a primitive-only type down to its raw content octets, recursing through
+// any nested constructed fragments.
+func derFragmentedContent(p *Packet) []byte {
+	if p.TagType != TypeConstructed {
+		return p.Data.Bytes()
+	}
+	var buf bytes.Buffer
+	for _, child := range p.Children {
+		buf.Write(derFragmentedContent(child))
+	}
+	return buf.Bytes()
 }
 
 func (p *Packet) DataLength() uint64 {
 	return uint64(p.Data.Len())
 }
 
+// encodeIdentifier writes a packet's identifier octet(s): the single
+// class/type/tag octet, followed by the base-128 continuation octets of
+// longTag when tag uses the high-tag-number form (tag == TagBitmask).
+func encodeIdentifier(out *bytes.Buffer, classType, tagType, tag uint8, longTag uint64) {
+	out.WriteByte(classType | tagType | tag)
+	if tag == TagBitmask {
+		out.Write(encodeBase128(longTag))
+	}
+}
+
+// encodeLength writes the minimal BER length octets for n: short form
+// below 128, otherwise the long form with no redundant leading zero byte.
+func encodeLength(out *bytes.Buffer, n uint64) {
+	if n <= 127 {
+		out.WriteByte(byte(n))
+		return
+	}
+	lengthOctets := EncodeInteger(n)
+	out.WriteByte(byte(len(lengthOctets)) | 128)
+	out.Write(lengthOctets)
+}
+
 func (p *Packet) Bytes() []byte {
-	n := p.DataLength()
-	packetLength := EncodeInteger(n)
-	size := 1 + len(packetLength) + int(n)
-	isBig := n > 127 || len(packetLength) > 1
-	if isBig {
-		size++
-	}
-
-	out := make([]byte, size)
-	out[0] = p.ClassType | p.TagType | p.Tag
-	offset := 2
-	if isBig {
-		out[1] = byte(len(packetLength) | 128)
-		offset += copy(out[2:], packetLength)
+	var out bytes.Buffer
+	encodeIdentifier(&out, p.ClassType, p.TagType, p.Tag, p.LongTag)
+
+	content := p.Data.Bytes()
+	if p.Indefinite {
+		out.WriteByte(0x80)
+		out.Write(content)
+		out.Write([]byte{TagEOC, 0x00})
 	} else {
-		out[1] = packetLength[0]
+		encodeLength(&out, uint64(len(content)))
+		out.Write(content)
 	}
-	copy(out[offset:], p.Data.Bytes())
-	return out
+	return out.Bytes()
 }
 
 func (p *Packet) AppendChild(child *Packet) {
@@ -387,6 +1081,16 @@ func Encode(classType, tagType, tag uint8, value interface{}, description string
 	return p
 }
 
+// EncodeLongTag builds a Packet whose identifier uses the high-tag-number
+// form, for tag values that don't fit in the 5 low bits of the identifier
+// octet (Tag > 30). The returned Packet has Tag set to TagBitmask and
+// LongTag set to tag.
+func EncodeLongTag(classType, tagType uint8, tag uint64, value interface{}, description string) *Packet {
+	p := Encode(classType, tagType, TagBitmask, value, description)
+	p.LongTag = tag
+	return p
+}
+
 func NewSequence(description string) *Packet {
 	return Encode(ClassUniversal, TypePrimitive, TagSequence, nil, description)
 }
@@ -403,7 +1107,18 @@ func NewBoolean(classType, tagType, tag uint8, value bool, description string) *
 	return p
 }
 
-func NewInteger(classType, tagType, tag uint8, value uint64, description string) *Packet {
+func NewInteger(classType, tagType, tag uint8, value int64, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write(EncodeSignedInteger(value))
+	return p
+}
+
+// NewUnsignedInteger builds an INTEGER/ENUMERATED Packet using the minimal
+// unsigned big-endian encoding, for callers that know their value never
+// needs the sign bit and want to avoid the extra leading 0x00 that
+// EncodeSignedInteger adds when the high bit of the minimal form is set.
+func NewUnsignedInteger(classType, tagType, tag uint8, value uint64, description string) *Packet {
 	p := Encode(classType, tagType, tag, nil, description)
 	p.Value = value
 	p.Data.Write(EncodeInteger(value))
@@ -416,3 +1131,45 @@ func NewString(classType, tagType, tag uint8, value, description string) *Packet
 	p.Data.Write([]byte(value))
 	return p
 }
+
+func NewUTF8String(classType, tagType, tag uint8, value, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write([]byte(value))
+	return p
+}
+
+func NewObjectIdentifier(classType, tagType, tag uint8, value ObjectIdentifier, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write(encodeObjectIdentifier(value))
+	return p
+}
+
+func NewRelativeOID(classType, tagType, tag uint8, value ObjectIdentifier, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write(encodeRelativeOID(value))
+	return p
+}
+
+func NewBitString(classType, tagType, tag uint8, value BitString, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write(encodeBitString(value))
+	return p
+}
+
+func NewGeneralizedTime(classType, tagType, tag uint8, value time.Time, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write([]byte(value.UTC().Format("20060102150405Z")))
+	return p
+}
+
+func NewReal(classType, tagType, tag uint8, value float64, description string) *Packet {
+	p := Encode(classType, tagType, tag, nil, description)
+	p.Value = value
+	p.Data.Write(encodeReal(value))
+	return p
+}
@@ -0,0 +1,355 @@
+package ber
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIndefiniteLengthRoundTrip(t *testing.T) {
+	// SEQUENCE (indefinite) { INTEGER 5 }
+	data := []byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00}
+
+	p, rest, err := DecodePacketErr(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("expected no remaining bytes, got %x", rest)
+	}
+	if !p.Indefinite {
+		t.Fatalf("expected Indefinite to be true")
+	}
+	if len(p.Children) != 1 {
+		t.Fatalf("expected 1 child, got %d", len(p.Children))
+	}
+	if v, ok := p.Children[0].Value.(int64); !ok || v != 5 {
+		t.Fatalf("expected child value int64(5), got %#v", p.Children[0].Value)
+	}
+
+	if got := p.Bytes(); !bytes.Equal(got, data) {
+		t.Fatalf("round trip mismatch: got %x want %x", got, data)
+	}
+}
+
+func TestHighTagNumberRoundTrip(t *testing.T) {
+	p := EncodeLongTag(ClassContext, TypePrimitive, 35, nil, "high tag")
+	p.Data.Write([]byte{0x01, 0x02, 0x03})
+
+	want := []byte{0x9F, 0x23, 0x03, 0x01, 0x02, 0x03}
+	if got := p.Bytes(); !bytes.Equal(got, want) {
+		t.Fatalf("encode mismatch: got %x want %x", got, want)
+	}
+
+	decoded, _, err := DecodePacketErr(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.Tag != TagBitmask || decoded.LongTag != 35 {
+		t.Fatalf("expected long tag 35, got Tag=%#x LongTag=%d", decoded.Tag, decoded.LongTag)
+	}
+	if !bytes.Equal(decoded.Data.Bytes(), []byte{0x01, 0x02, 0x03}) {
+		t.Fatalf("unexpected content: %x", decoded.Data.Bytes())
+	}
+}
+
+func TestSignedIntegerRoundTrip(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, -256, 1 << 40, -(1 << 40)} {
+		encoded := EncodeSignedInteger(v)
+		if got := DecodeSignedInteger(encoded); got != v {
+			t.Errorf("EncodeSignedInteger/DecodeSignedInteger(%d): got %d via %x", v, got, encoded)
+		}
+	}
+}
+
+func TestObjectIdentifierRoundTrip(t *testing.T) {
+	// sha256WithRSAEncryption
+	oid := ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	want := []byte{0x06, 0x09, 0x2A, 0x86, 0x48, 0x86, 0xF7, 0x0D, 0x01, 0x01, 0x0B}
+
+	p := NewObjectIdentifier(ClassUniversal, TypePrimitive, TagObjectIdentifier, oid, "")
+	if got := p.Bytes(); !bytes.Equal(got, want) {
+		t.Fatalf("encode mismatch: got %x want %x", got, want)
+	}
+
+	decoded, _, err := DecodePacketErr(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, ok := decoded.Value.(ObjectIdentifier)
+	if !ok || !reflect.DeepEqual(got, oid) {
+		t.Fatalf("expected %v, got %#v", oid, decoded.Value)
+	}
+	if got.String() != "1.2.840.113549.1.1.11" {
+		t.Fatalf("unexpected String(): %s", got.String())
+	}
+}
+
+func TestBitStringRoundTrip(t *testing.T) {
+	value := BitString{Bytes: []byte{0xF0}, BitLength: 4}
+	p := NewBitString(ClassUniversal, TypePrimitive, TagBitString, value, "")
+
+	want := []byte{0x03, 0x02, 0x04, 0xF0}
+	if got := p.Bytes(); !bytes.Equal(got, want) {
+		t.Fatalf("encode mismatch: got %x want %x", got, want)
+	}
+
+	decoded, _, err := DecodePacketErr(want)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	bs, ok := decoded.Value.(BitString)
+	if !ok || bs.BitLength != 4 || !bytes.Equal(bs.Bytes, []byte{0xF0}) {
+		t.Fatalf("unexpected BitString: %#v", decoded.Value)
+	}
+}
+
+func TestUTCTimeDecode(t *testing.T) {
+	cases := []struct {
+		data string
+		want time.Time
+	}{
+		{"970101120000Z", time.Date(1997, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{"650101000000Z", time.Date(1965, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		p, _, err := DecodePacketErr(append([]byte{TagUTCTime, byte(len(c.data))}, []byte(c.data)...))
+		if err != nil {
+			t.Fatalf("unexpected error decoding %q: %v", c.data, err)
+		}
+		got, ok := p.Value.(time.Time)
+		if !ok || !got.Equal(c.want) {
+			t.Errorf("decodeUTCTime(%q) = %v, want %v", c.data, p.Value, c.want)
+		}
+	}
+}
+
+func TestGeneralizedTimeDecode(t *testing.T) {
+	data := "20230615120000Z"
+	p, _, err := DecodePacketErr(append([]byte{TagGeneralizedTime, byte(len(data))}, []byte(data)...))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := time.Date(2023, 6, 15, 12, 0, 0, 0, time.UTC)
+	got, ok := p.Value.(time.Time)
+	if !ok || !got.Equal(want) {
+		t.Fatalf("got %v, want %v", p.Value, want)
+	}
+}
+
+func TestRealRoundTrip(t *testing.T) {
+	for _, v := range []float64{0, 1.5, -2, 100, -0.25, math.Inf(1), math.Inf(-1)} {
+		p := NewReal(ClassUniversal, TypePrimitive, TagRealFloat, v, "")
+		decoded, _, err := DecodePacketErr(p.Bytes())
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %v", v, err)
+		}
+		got, ok := decoded.Value.(float64)
+		if !ok || got != v {
+			t.Errorf("real round trip for %v: got %v (%x)", v, decoded.Value, p.Bytes())
+		}
+	}
+}
+
+func TestDecodePacketErrMalformed(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", []byte{}, ErrTruncated},
+		{"truncated identifier only", []byte{0x30}, ErrTruncated},
+		{"truncated content", []byte{0x02, 0x05, 0x01}, ErrLengthOverflow},
+		{"reserved length", []byte{0x02, 0xFF}, ErrReservedLength},
+		{"too many length octets", []byte{0x02, 0x89, 1, 2, 3, 4, 5, 6, 7, 8, 9}, ErrLengthOverflow},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, _, err := DecodePacketErr(c.data)
+			if err != c.want {
+				t.Fatalf("got err=%v, want %v", err, c.want)
+			}
+			if p != nil {
+				t.Fatalf("expected nil packet on error")
+			}
+			if got := DecodePacket(c.data); got != nil {
+				t.Fatalf("DecodePacket should return nil on error, got %#v", got)
+			}
+		})
+	}
+}
+
+func TestDecodePacketStrictDER(t *testing.T) {
+	t.Run("indefinite length rejected", func(t *testing.T) {
+		data := []byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00}
+		if _, _, err := DecodePacketStrict(data, ModeDER); err != ErrDERIndefiniteLength {
+			t.Fatalf("got %v, want ErrDERIndefiniteLength", err)
+		}
+		if _, _, err := DecodePacketStrict(data, ModeBER); err != nil {
+			t.Fatalf("BER mode should accept indefinite length, got %v", err)
+		}
+	})
+
+	t.Run("non-minimal length rejected", func(t *testing.T) {
+		data := []byte{0x04, 0x81, 0x05, 'h', 'e', 'l', 'l', 'o'}
+		if _, _, err := DecodePacketStrict(data, ModeDER); err != ErrDERNonMinimalLength {
+			t.Fatalf("got %v, want ErrDERNonMinimalLength", err)
+		}
+	})
+
+	t.Run("constructed primitive string rejected", func(t *testing.T) {
+		data := []byte{0x24, 0x04, 0x04, 0x02, 'a', 'b'}
+		if _, _, err := DecodePacketStrict(data, ModeDER); err != ErrDERConstructedString {
+			t.Fatalf("got %v, want ErrDERConstructedString", err)
+		}
+	})
+
+	t.Run("non-canonical boolean rejected", func(t *testing.T) {
+		data := []byte{0x01, 0x01, 0x7F}
+		if _, _, err := DecodePacketStrict(data, ModeDER); err != ErrDERBoolean {
+			t.Fatalf("got %v, want ErrDERBoolean", err)
+		}
+	})
+
+	t.Run("wrong-length boolean rejected", func(t *testing.T) {
+		data := []byte{0x01, 0x02, 0xFF, 0x00}
+		if _, _, err := DecodePacketStrict(data, ModeDER); err != ErrDERBoolean {
+			t.Fatalf("got %v, want ErrDERBoolean", err)
+		}
+	})
+
+	t.Run("out of order SET rejected", func(t *testing.T) {
+		second := NewInteger(ClassUniversal, TypePrimitive, TagInteger, 1, "")
+		first := NewInteger(ClassUniversal, TypePrimitive, TagInteger, 2, "")
+		set := Encode(ClassUniversal, TypeConstructed, TagSet, nil, "")
+		set.AppendChild(first)
+		set.AppendChild(second)
+
+		if _, _, err := DecodePacketStrict(set.Bytes(), ModeDER); err != ErrDERSetOrder {
+			t.Fatalf("got %v, want ErrDERSetOrder", err)
+		}
+	})
+}
+
+func TestEncodeDERBoolean(t *testing.T) {
+	for _, v := range []bool{true, false} {
+		p := NewBoolean(ClassUniversal, TypePrimitive, TagBoolean, v, "")
+		der := p.EncodeDER()
+
+		wantByte := byte(0x00)
+		if v {
+			wantByte = 0xFF
+		}
+		if want := []byte{0x01, 0x01, wantByte}; !bytes.Equal(der, want) {
+			t.Fatalf("EncodeDER(%v) = %x, want %x", v, der, want)
+		}
+
+		decoded, _, err := DecodePacketStrict(der, ModeDER)
+		if err != nil {
+			t.Fatalf("DecodePacketStrict rejected NewBoolean(%v).EncodeDER(): %v", v, err)
+		}
+		if got, ok := decoded.Value.(bool); !ok || got != v {
+			t.Fatalf("decoded boolean = %#v, want %v", decoded.Value, v)
+		}
+	}
+}
+
+func TestEncodeDERFlattensConstructedString(t *testing.T) {
+	first := Encode(ClassUniversal, TypePrimitive, TagOctetString, nil, "")
+	first.Data.Write([]byte("ab"))
+	second := Encode(ClassUniversal, TypePrimitive, TagOctetString, nil, "")
+	second.Data.Write([]byte("cd"))
+
+	p := Encode(ClassUniversal, TypeConstructed, TagOctetString, nil, "")
+	p.AppendChild(first)
+	p.AppendChild(second)
+
+	want := []byte{0x04, 0x04, 'a', 'b', 'c', 'd'}
+	if got := p.EncodeDER(); !bytes.Equal(got, want) {
+		t.Fatalf("EncodeDER mismatch: got %x want %x", got, want)
+	}
+}
+
+func TestEncodeDERSortsSet(t *testing.T) {
+	second := NewInteger(ClassUniversal, TypePrimitive, TagInteger, 1, "")
+	first := NewInteger(ClassUniversal, TypePrimitive, TagInteger, 2, "")
+	set := Encode(ClassUniversal, TypeConstructed, TagSet, nil, "")
+	set.AppendChild(first)
+	set.AppendChild(second)
+
+	der := set.EncodeDER()
+	decoded, _, err := DecodePacketStrict(der, ModeDER)
+	if err != nil {
+		t.Fatalf("EncodeDER output should be valid DER, got error: %v", err)
+	}
+	if len(decoded.Children) != 2 {
+		t.Fatalf("expected 2 children, got %d", len(decoded.Children))
+	}
+}
+
+// ldapBindRequestSeed builds a small LDAPMessage-shaped BindRequest using
+// this package's own constructors, for use as fuzz seed corpus: a
+// SEQUENCE { messageID INTEGER, bindRequest [APPLICATION 0] SEQUENCE {
+// version INTEGER, name OCTET STRING, simple [0] OCTET STRING } }.
+func ldapBindRequestSeed() []byte {
+	msgID := NewInteger(ClassUniversal, TypePrimitive, TagInteger, 1, "message ID")
+
+	version := NewInteger(ClassUniversal, TypePrimitive, TagInteger, 3, "version")
+	name := NewString(ClassUniversal, TypePrimitive, TagOctetString, "cn=admin,dc=example,dc=com", "name")
+	auth := Encode(ClassContext, TypePrimitive, 0, nil, "simple auth")
+	auth.Data.Write([]byte("password"))
+
+	bindRequest := Encode(ClassApplication, TypeConstructed, 0, nil, "bind request")
+	bindRequest.AppendChild(version)
+	bindRequest.AppendChild(name)
+	bindRequest.AppendChild(auth)
+
+	msg := Encode(ClassUniversal, TypeConstructed, TagSequence, nil, "LDAPMessage")
+	msg.AppendChild(msgID)
+	msg.AppendChild(bindRequest)
+	return msg.Bytes()
+}
+
+func FuzzDecodePacketErr(f *testing.F) {
+	f.Add(ldapBindRequestSeed())
+	f.Add([]byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00})
+	f.Add([]byte{0x04, 0x81, 0x05, 'h', 'e', 'l', 'l', 'o'})
+	f.Add([]byte{0x9F, 0x23, 0x03, 0x01, 0x02, 0x03})
+	f.Add([]byte{})
+	f.Add([]byte{0x30, 0x84, 0xFF, 0xFF, 0xFF, 0xFF})
+	f.Add([]byte{0x02, 0xFF})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, _, err := DecodePacketErr(data)
+		if err != nil {
+			if p != nil {
+				t.Fatalf("expected nil packet alongside error %v", err)
+			}
+			return
+		}
+		if p == nil {
+			t.Fatalf("expected non-nil packet when err is nil")
+		}
+		_ = p.Bytes()
+	})
+}
+
+func FuzzDecodePacketStrictDER(f *testing.F) {
+	f.Add(ldapBindRequestSeed())
+	f.Add([]byte{0x30, 0x80, 0x02, 0x01, 0x05, 0x00, 0x00})
+	f.Add([]byte{0x04, 0x81, 0x05, 'h', 'e', 'l', 'l', 'o'})
+	f.Add([]byte{0x24, 0x04, 0x04, 0x02, 'a', 'b'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, _, err := DecodePacketStrict(data, ModeDER)
+		if err != nil {
+			if p != nil {
+				t.Fatalf("expected nil packet alongside error %v", err)
+			}
+			return
+		}
+		_ = p.EncodeDER()
+	})
+}